@@ -0,0 +1,207 @@
+package spectator
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/jxwr/cc/topo"
+)
+
+// TopoEventType 标识一次拓扑变化的类型
+type TopoEventType int
+
+const (
+	NodeAdded TopoEventType = iota
+	NodeRemoved
+	RoleChanged
+	SlotsMigrated
+	NodeFailed
+	ReplicaSetChanged
+	// NodeSuspected和NodeRecovered标记quorumTracker计算出的gossip quorum
+	// PFAIL->FAIL状态跨越,与NodeFailed不同——后者只是两次拓扑快照之间
+	// Fail()标志位翻转的结果,不关心具体是怎么判定的。
+	NodeSuspected
+	NodeRecovered
+)
+
+func (t TopoEventType) String() string {
+	switch t {
+	case NodeAdded:
+		return "NodeAdded"
+	case NodeRemoved:
+		return "NodeRemoved"
+	case RoleChanged:
+		return "RoleChanged"
+	case SlotsMigrated:
+		return "SlotsMigrated"
+	case NodeFailed:
+		return "NodeFailed"
+	case ReplicaSetChanged:
+		return "ReplicaSetChanged"
+	case NodeSuspected:
+		return "NodeSuspected"
+	case NodeRecovered:
+		return "NodeRecovered"
+	default:
+		return "Unknown"
+	}
+}
+
+// TopoEvent 描述BuildClusterTopo前后拓扑快照之间的一次差异
+type TopoEvent struct {
+	Type TopoEventType
+
+	NodeId  string
+	OldRole string
+	NewRole string
+	Ranges  []topo.Range
+}
+
+// subscriberBufferSize 是每个订阅者channel的缓冲区大小,满了之后按drop-oldest处理
+const subscriberBufferSize = 64
+
+type subscriber struct {
+	ch chan TopoEvent
+}
+
+// topoEventBus 把BuildClusterTopo产生的差异事件非阻塞地广播给所有订阅者
+type topoEventBus struct {
+	mutex       sync.Mutex
+	subscribers map[*subscriber]struct{}
+	dropped     uint64
+}
+
+func newTopoEventBus() *topoEventBus {
+	return &topoEventBus{
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// subscribe 注册一个新的订阅者,返回事件channel和一个取消订阅的函数
+func (bus *topoEventBus) subscribe() (<-chan TopoEvent, func()) {
+	sub := &subscriber{ch: make(chan TopoEvent, subscriberBufferSize)}
+
+	bus.mutex.Lock()
+	bus.subscribers[sub] = struct{}{}
+	bus.mutex.Unlock()
+
+	cancel := func() {
+		bus.mutex.Lock()
+		defer bus.mutex.Unlock()
+		if _, ok := bus.subscribers[sub]; ok {
+			delete(bus.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+
+	return sub.ch, cancel
+}
+
+// publish 把事件发给所有订阅者。订阅者消费太慢时丢弃其最旧的未消费事件,
+// 并用dropped计数器记录下来,而不是阻塞BuildClusterTopo。
+func (bus *topoEventBus) publish(ev TopoEvent) {
+	bus.mutex.Lock()
+	defer bus.mutex.Unlock()
+
+	for sub := range bus.subscribers {
+		select {
+		case sub.ch <- ev:
+		default:
+			select {
+			case <-sub.ch:
+			default:
+			}
+			select {
+			case sub.ch <- ev:
+			default:
+				atomic.AddUint64(&bus.dropped, 1)
+			}
+		}
+	}
+}
+
+func (bus *topoEventBus) droppedCount() uint64 {
+	return atomic.LoadUint64(&bus.dropped)
+}
+
+// Subscribe 返回一个topology diff事件的只读channel,以及用于取消订阅的函数。
+// 失败切换/迁移控制器可以借此实时响应拓扑变化,而不必轮询ClusterTopo。
+func (self *Spectator) Subscribe() (<-chan TopoEvent, func()) {
+	return self.events.subscribe()
+}
+
+// DroppedEventCount 返回因订阅者消费过慢而被丢弃的拓扑事件数量
+func (self *Spectator) DroppedEventCount() uint64 {
+	return self.events.droppedCount()
+}
+
+// diffClusterTopo 比较BuildClusterTopo前后的两份拓扑快照,生成对应的TopoEvent列表。
+// 调用方需要持有self.mutex的写锁。
+func diffClusterTopo(prev, next *topo.Cluster) []TopoEvent {
+	events := []TopoEvent{}
+	if prev == nil || next == nil {
+		return events
+	}
+
+	prevNodes := map[string]*topo.Node{}
+	for _, n := range prev.LocalRegionNodes() {
+		prevNodes[n.Id()] = n
+	}
+	nextNodes := map[string]*topo.Node{}
+	for _, n := range next.LocalRegionNodes() {
+		nextNodes[n.Id()] = n
+	}
+
+	for id, n := range nextNodes {
+		old, ok := prevNodes[id]
+		if !ok {
+			events = append(events, TopoEvent{Type: NodeAdded, NodeId: id})
+			continue
+		}
+		if old.Role() != n.Role() {
+			events = append(events, TopoEvent{Type: RoleChanged, NodeId: id, OldRole: old.Role(), NewRole: n.Role()})
+		}
+		if !old.Fail() && n.Fail() {
+			events = append(events, TopoEvent{Type: NodeFailed, NodeId: id})
+		}
+		if !sameRanges(old.Ranges(), n.Ranges()) {
+			events = append(events, TopoEvent{Type: SlotsMigrated, NodeId: id, Ranges: n.Ranges()})
+		}
+	}
+	for id := range prevNodes {
+		if _, ok := nextNodes[id]; !ok {
+			events = append(events, TopoEvent{Type: NodeRemoved, NodeId: id})
+		}
+	}
+
+	if !sameReplicaSetAssignment(prevNodes, nextNodes) {
+		events = append(events, TopoEvent{Type: ReplicaSetChanged})
+	}
+
+	return events
+}
+
+func sameRanges(a, b []topo.Range) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func sameReplicaSetAssignment(prevNodes, nextNodes map[string]*topo.Node) bool {
+	for id, n := range nextNodes {
+		old, ok := prevNodes[id]
+		if !ok {
+			continue
+		}
+		if old.ParentId() != n.ParentId() {
+			return false
+		}
+	}
+	return true
+}
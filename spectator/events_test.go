@@ -0,0 +1,69 @@
+package spectator
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestTopoEventBusPublishDelivers(t *testing.T) {
+	bus := newTopoEventBus()
+	ch, cancel := bus.subscribe()
+	defer cancel()
+
+	bus.publish(TopoEvent{Type: NodeAdded, NodeId: "node1"})
+
+	select {
+	case ev := <-ch:
+		if ev.Type != NodeAdded || ev.NodeId != "node1" {
+			t.Fatalf("received %+v, want {Type: NodeAdded, NodeId: node1}", ev)
+		}
+	default:
+		t.Fatalf("subscriber channel empty after publish")
+	}
+}
+
+func TestTopoEventBusPublishDropsOldest(t *testing.T) {
+	bus := newTopoEventBus()
+	ch, cancel := bus.subscribe()
+	defer cancel()
+
+	for i := 0; i < subscriberBufferSize; i++ {
+		bus.publish(TopoEvent{Type: NodeAdded, NodeId: strconv.Itoa(i)})
+	}
+
+	// The buffer is now full with ids "0".."63". One more publish must drop
+	// the oldest ("0") to make room for the new event rather than blocking.
+	bus.publish(TopoEvent{Type: NodeRemoved, NodeId: "newest"})
+
+	drained := []TopoEvent{}
+	for {
+		select {
+		case ev := <-ch:
+			drained = append(drained, ev)
+			continue
+		default:
+		}
+		break
+	}
+
+	if len(drained) != subscriberBufferSize {
+		t.Fatalf("drained %d events, want %d (buffer size, after dropping the oldest)", len(drained), subscriberBufferSize)
+	}
+	if drained[0].NodeId == "0" {
+		t.Fatalf("oldest event (id 0) was not dropped, still present at the front of the buffer")
+	}
+	last := drained[len(drained)-1]
+	if last.Type != NodeRemoved || last.NodeId != "newest" {
+		t.Fatalf("last drained event = %+v, want the newest publish to survive the drop", last)
+	}
+}
+
+func TestTopoEventBusCancelClosesChannel(t *testing.T) {
+	bus := newTopoEventBus()
+	ch, cancel := bus.subscribe()
+	cancel()
+
+	if _, ok := <-ch; ok {
+		t.Fatalf("channel still open after cancel()")
+	}
+}
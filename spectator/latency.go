@@ -0,0 +1,185 @@
+package spectator
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jxwr/cc/redis"
+	"github.com/jxwr/cc/topo"
+)
+
+var ErrNoReplicaAvailable = errors.New("spectator: no replica available")
+
+const (
+	// latencyEwmaAlpha 控制新样本在EWMA中的权重
+	latencyEwmaAlpha = 0.2
+	// latencyFreshTicks 超过这么多个tick没有成功探测过的节点视为过期,不参与路由
+	latencyFreshTicks = 5
+)
+
+// nodeLatency 保存单个节点PING RTT的指数加权移动平均值
+type nodeLatency struct {
+	ewma     time.Duration
+	lastTick int64
+}
+
+// latencyStats 保存分片内所有节点的RTT采样,由Spectator.mutex保护
+type latencyStats struct {
+	samples map[string]*nodeLatency
+}
+
+func newLatencyStats() *latencyStats {
+	return &latencyStats{
+		samples: map[string]*nodeLatency{},
+	}
+}
+
+func (ls *latencyStats) update(nodeId string, rtt time.Duration, tick int64) {
+	s, ok := ls.samples[nodeId]
+	if !ok {
+		s = &nodeLatency{}
+		ls.samples[nodeId] = s
+	}
+	if s.lastTick == 0 {
+		s.ewma = rtt
+	} else {
+		s.ewma = time.Duration(latencyEwmaAlpha*float64(rtt) + (1-latencyEwmaAlpha)*float64(s.ewma))
+	}
+	s.lastTick = tick
+}
+
+// fresh 返回节点的EWMA RTT,如果节点从未被探测过,或者最近一次成功探测距当前tick
+// 超过了latencyFreshTicks,则认为数据过期,ok返回false
+func (ls *latencyStats) fresh(nodeId string, tick int64) (time.Duration, bool) {
+	s, ok := ls.samples[nodeId]
+	if !ok {
+		return 0, false
+	}
+	if tick-s.lastTick > latencyFreshTicks {
+		return 0, false
+	}
+	return s.ewma, true
+}
+
+// probeLatencies 对当前拓扑中的所有本地区域节点发起一次PING探测,更新RTT的EWMA
+func (self *Spectator) probeLatencies() {
+	self.mutex.RLock()
+	cluster := self.ClusterTopo
+	tick := self.tickCount
+	self.mutex.RUnlock()
+
+	if cluster == nil {
+		return
+	}
+
+	nodes := cluster.LocalRegionNodes()
+	for _, node := range nodes {
+		go func(id, addr string) {
+			start := time.Now()
+			if !redis.IsAlive(addr) {
+				return
+			}
+			rtt := time.Since(start)
+
+			self.mutex.Lock()
+			self.latencies.update(id, rtt, tick)
+			self.mutex.Unlock()
+		}(node.Id(), node.Addr())
+	}
+}
+
+// closestNode 在候选节点中挑选RTT EWMA最小、且探测数据新鲜、未处于PFail/Fail状态的节点
+func (self *Spectator) closestNode(nodes []*topo.Node, slaveOnly bool) (string, error) {
+	bestId := ""
+	var bestRtt time.Duration = -1
+
+	for _, node := range nodes {
+		if slaveOnly && node.IsMaster() {
+			continue
+		}
+		if node.PFail() || node.Fail() {
+			continue
+		}
+		rtt, ok := self.latencies.fresh(node.Id(), self.tickCount)
+		if !ok {
+			continue
+		}
+		if bestRtt < 0 || rtt < bestRtt {
+			bestRtt = rtt
+			bestId = node.Id()
+		}
+	}
+
+	if bestId == "" {
+		return "", ErrNoReplicaAvailable
+	}
+	return bestId, nil
+}
+
+// ClosestReplicaInReplicaSet 返回nodeId所在分片内RTT EWMA最小的节点,借鉴了
+// go-redis集群客户端的RouteByLatency策略。slaveOnly为true时只在从节点中选择。
+func (self *Spectator) ClosestReplicaInReplicaSet(nodeId string, slaveOnly bool) (string, error) {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	rs := self.ClusterTopo.FindReplicaSetByNode(nodeId)
+	if rs == nil {
+		return "", ErrNodeNotExist
+	}
+
+	return self.closestNode(rs.AllNodes(), slaveOnly)
+}
+
+// ClosestReplicaInReplicaSetWithMaxLag 和ClosestReplicaInReplicaSet类似,但会先
+// 剔除复制偏移量落后master超过maxLagBytes的从节点,避免路由到数据过旧的副本,
+// 对应go-redis RouteByLatency之上叠加的“不读取落后太多的从库”约束。
+func (self *Spectator) ClosestReplicaInReplicaSetWithMaxLag(nodeId string, maxLagBytes int64) (string, error) {
+	self.mutex.RLock()
+	rs := self.ClusterTopo.FindReplicaSetByNode(nodeId)
+	self.mutex.RUnlock()
+
+	if rs == nil {
+		return "", ErrNodeNotExist
+	}
+
+	rmap := self.FetchReplOffsetInReplicaSet(rs)
+
+	var masterOffset int64 = -1
+	for _, node := range rs.AllNodes() {
+		if node.IsMaster() {
+			masterOffset = rmap[node.Id()]
+		}
+	}
+
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	candidates := []*topo.Node{}
+	for _, node := range rs.AllNodes() {
+		if node.IsMaster() {
+			continue
+		}
+		off, ok := rmap[node.Id()]
+		if !ok || masterOffset < 0 || off < 0 {
+			continue
+		}
+		if masterOffset-off > maxLagBytes {
+			continue
+		}
+		candidates = append(candidates, node)
+	}
+
+	return self.closestNode(candidates, true)
+}
+
+// Latencies 返回当前各节点PING RTT EWMA的快照,供HTTP/API层展示使用
+func (self *Spectator) Latencies() map[string]time.Duration {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	result := map[string]time.Duration{}
+	for id, s := range self.latencies.samples {
+		result[id] = s.ewma
+	}
+	return result
+}
@@ -0,0 +1,40 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLatencyStatsUpdate(t *testing.T) {
+	ls := newLatencyStats()
+
+	ls.update("node1", 100*time.Millisecond, 1)
+	if got, ok := ls.fresh("node1", 1); !ok || got != 100*time.Millisecond {
+		t.Fatalf("fresh() after first sample = (%v, %v), want (100ms, true)", got, ok)
+	}
+
+	ls.update("node1", 200*time.Millisecond, 2)
+	want := time.Duration(latencyEwmaAlpha*float64(200*time.Millisecond) + (1-latencyEwmaAlpha)*float64(100*time.Millisecond))
+	if got, ok := ls.fresh("node1", 2); !ok || got != want {
+		t.Fatalf("fresh() after EWMA update = (%v, %v), want (%v, true)", got, ok, want)
+	}
+}
+
+func TestLatencyStatsFreshUnknownNode(t *testing.T) {
+	ls := newLatencyStats()
+	if _, ok := ls.fresh("node1", 1); ok {
+		t.Fatalf("fresh() on a node that was never probed, want ok = false")
+	}
+}
+
+func TestLatencyStatsFreshExpires(t *testing.T) {
+	ls := newLatencyStats()
+	ls.update("node1", 100, 1)
+
+	if _, ok := ls.fresh("node1", 1+latencyFreshTicks); !ok {
+		t.Fatalf("fresh() at exactly latencyFreshTicks ticks later, want ok = true")
+	}
+	if _, ok := ls.fresh("node1", 1+latencyFreshTicks+1); ok {
+		t.Fatalf("fresh() more than latencyFreshTicks ticks after the last sample, want ok = false")
+	}
+}
@@ -0,0 +1,113 @@
+package spectator
+
+import "sync"
+
+// QuorumConfig控制gossip quorum下PFAIL->FAIL状态转换和恢复的阈值。
+// 零值会回退到defaultQuorum。
+type QuorumConfig struct {
+	WindowTicks   int // K: 每个节点保留最近多少个tick
+	RequiredSeeds int // Q: 一个tick内至少有多少个不同seed上报PFail才算数
+	RequiredTicks int // M: 最近WindowTicks个tick中,至少多少个达到quorum才转为FAIL
+	RecoveryTicks int // M': 连续多少个干净的tick才能清除FAIL
+}
+
+var defaultQuorum = QuorumConfig{
+	WindowTicks:   10,
+	RequiredSeeds: 2,
+	RequiredTicks: 5,
+	RecoveryTicks: 5,
+}
+
+func (c QuorumConfig) withDefaults() QuorumConfig {
+	d := defaultQuorum
+	if c.WindowTicks > 0 {
+		d.WindowTicks = c.WindowTicks
+	}
+	if c.RequiredSeeds > 0 {
+		d.RequiredSeeds = c.RequiredSeeds
+	}
+	if c.RequiredTicks > 0 {
+		d.RequiredTicks = c.RequiredTicks
+	}
+	if c.RecoveryTicks > 0 {
+		d.RecoveryTicks = c.RecoveryTicks
+	}
+	return d
+}
+
+// nodeFailWindow是按节点维护的环形缓冲区,记录最近WindowTicks个tick里各自
+// 是哪些seed上报了PFail。它挂在quorumTracker上、以节点ID为key,所以不会
+// 随着每个tick重建的*topo.Cluster一起被重置。
+type nodeFailWindow struct {
+	ticks   []map[string]bool
+	next    int
+	failing bool
+	clean   int
+}
+
+// quorumTracker只有在最近WindowTicks个tick中,至少RequiredTicks个tick都有
+// 不少于RequiredSeeds个不同seed上报PFail时,才把节点从PFAIL转为FAIL;也只有
+// 连续RecoveryTicks个干净的tick之后,才把它降回健康状态。
+type quorumTracker struct {
+	mutex   sync.Mutex
+	cfg     QuorumConfig
+	windows map[string]*nodeFailWindow
+}
+
+func newQuorumTracker(cfg QuorumConfig) *quorumTracker {
+	return &quorumTracker{
+		cfg:     cfg.withDefaults(),
+		windows: map[string]*nodeFailWindow{},
+	}
+}
+
+func (qt *quorumTracker) windowFor(nodeId string) *nodeFailWindow {
+	w, ok := qt.windows[nodeId]
+	if !ok {
+		w = &nodeFailWindow{ticks: make([]map[string]bool, qt.cfg.WindowTicks)}
+		qt.windows[nodeId] = w
+	}
+	return w
+}
+
+// observe记录nodeId在当前tick上报PFail的seed地址集合(没有就传nil/空map),
+// 然后重新判断是否跨过FAIL阈值。只有这次观测跨越了阈值,changed才为true,
+// 此时evType是NodeSuspected或NodeRecovered。
+func (qt *quorumTracker) observe(nodeId string, seedsReporting map[string]bool) (evType TopoEventType, changed bool) {
+	qt.mutex.Lock()
+	defer qt.mutex.Unlock()
+
+	w := qt.windowFor(nodeId)
+	w.ticks[w.next] = seedsReporting
+	w.next = (w.next + 1) % len(w.ticks)
+
+	quorumTicks := 0
+	for _, s := range w.ticks {
+		if len(s) >= qt.cfg.RequiredSeeds {
+			quorumTicks++
+		}
+	}
+
+	if len(seedsReporting) >= qt.cfg.RequiredSeeds {
+		w.clean = 0
+	} else {
+		w.clean++
+	}
+
+	if !w.failing && quorumTicks >= qt.cfg.RequiredTicks {
+		w.failing = true
+		return NodeSuspected, true
+	}
+	if w.failing && w.clean >= qt.cfg.RecoveryTicks {
+		w.failing = false
+		// 清空窗口,避免恢复之前观测到的tick在之后的调用里被再次计入
+		// quorumTicks,导致一个一直保持干净的节点被错误地重新判定为FAIL。
+		for i := range w.ticks {
+			w.ticks[i] = nil
+		}
+		w.clean = 0
+		return NodeRecovered, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,66 @@
+package spectator
+
+import "testing"
+
+func seedSet(addrs ...string) map[string]bool {
+	s := map[string]bool{}
+	for _, a := range addrs {
+		s[a] = true
+	}
+	return s
+}
+
+func TestQuorumTrackerPromotesAfterRequiredTicks(t *testing.T) {
+	cfg := QuorumConfig{WindowTicks: 5, RequiredSeeds: 2, RequiredTicks: 3, RecoveryTicks: 2}
+	qt := newQuorumTracker(cfg)
+
+	var evType TopoEventType
+	var changed bool
+	for i := 0; i < 2; i++ {
+		evType, changed = qt.observe("node1", seedSet("seed1", "seed2"))
+		if changed {
+			t.Fatalf("tick %d: observe() changed = true before RequiredTicks was reached", i)
+		}
+	}
+
+	evType, changed = qt.observe("node1", seedSet("seed1", "seed2"))
+	if !changed || evType != NodeSuspected {
+		t.Fatalf("observe() = (%v, %v), want (NodeSuspected, true) on reaching RequiredTicks", evType, changed)
+	}
+}
+
+func TestQuorumTrackerIgnoresSubQuorumTicks(t *testing.T) {
+	cfg := QuorumConfig{WindowTicks: 5, RequiredSeeds: 2, RequiredTicks: 3, RecoveryTicks: 2}
+	qt := newQuorumTracker(cfg)
+
+	for i := 0; i < 10; i++ {
+		_, changed := qt.observe("node1", seedSet("seed1"))
+		if changed {
+			t.Fatalf("tick %d: observe() changed = true with only 1 of %d required seeds reporting", i, cfg.RequiredSeeds)
+		}
+	}
+}
+
+func TestQuorumTrackerRecoversAfterCleanTicks(t *testing.T) {
+	cfg := QuorumConfig{WindowTicks: 5, RequiredSeeds: 2, RequiredTicks: 2, RecoveryTicks: 2}
+	qt := newQuorumTracker(cfg)
+
+	for i := 0; i < 2; i++ {
+		qt.observe("node1", seedSet("seed1", "seed2"))
+	}
+
+	evType, changed := qt.observe("node1", nil)
+	if changed {
+		t.Fatalf("observe() changed = true on first clean tick, want false before RecoveryTicks")
+	}
+
+	evType, changed = qt.observe("node1", nil)
+	if !changed || evType != NodeRecovered {
+		t.Fatalf("observe() = (%v, %v), want (NodeRecovered, true) after RecoveryTicks clean ticks", evType, changed)
+	}
+
+	_, changed = qt.observe("node1", nil)
+	if changed {
+		t.Fatalf("observe() changed = true on the tick right after recovery, want false: stale pre-recovery quorum ticks must not linger in the window")
+	}
+}
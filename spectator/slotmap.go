@@ -0,0 +1,113 @@
+package spectator
+
+import (
+	"bytes"
+	"log"
+
+	"github.com/jxwr/cc/redis"
+	"github.com/jxwr/cc/topo"
+)
+
+const numSlots = 16384
+
+// crc16实现了Redis Cluster用来把key映射到slot的CRC16/XMODEM变体
+func crc16(data []byte) uint16 {
+	var crc uint16
+	for _, b := range data {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = (crc << 1) ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// hashtagKey在key中同时存在'{'和其后非空的'}'时,返回两者之间的子串,否则
+// 原样返回key。对应Redis Cluster的hashtag规则,用于把多key操作路由到同一slot。
+func hashtagKey(key []byte) []byte {
+	start := bytes.IndexByte(key, '{')
+	if start < 0 {
+		return key
+	}
+	end := bytes.IndexByte(key[start+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[start+1 : start+1+end]
+}
+
+// keySlot返回key哈希到的cluster slot(0..numSlots-1)
+func keySlot(key []byte) int {
+	return int(crc16(hashtagKey(key))) % numSlots
+}
+
+// mergeClusterSlots把CLUSTER NODES解析出的拓扑和从seed拿到的结构化CLUSTER
+// SLOTS视图做一致性校准。slot->node归属以CLUSTER SLOTS为准;存活标志、
+// migrating标记和region/zone/room标签仍以CLUSTER NODES为准,所以这里只
+// 重写每个节点的ranges。两份视图不一致时会记录日志,不做静默处理。
+func (self *Spectator) mergeClusterSlots(cluster *topo.Cluster, seed *topo.Node) error {
+	slots, err := redis.ClusterSlots(seed.Addr())
+	if err != nil {
+		return err
+	}
+
+	byAddr := map[string][]topo.Range{}
+	for _, sr := range slots {
+		byAddr[sr.Master] = append(byAddr[sr.Master], topo.Range{sr.Start, sr.End})
+	}
+
+	for _, node := range cluster.LocalRegionNodes() {
+		ranges := byAddr[node.Addr()]
+		if !sameRanges(node.Ranges(), ranges) {
+			log.Printf("spectator: CLUSTER SLOTS/CLUSTER NODES diverge for %s: nodes=%v slots=%v, preferring CLUSTER SLOTS",
+				node.Addr(), node.Ranges(), ranges)
+			node.ClearRanges()
+			for _, r := range ranges {
+				node.AddRange(r)
+			}
+		}
+	}
+
+	return nil
+}
+
+// computeSlotMap为cluster的本地区域节点构建slot -> node索引,每个tick在
+// self.mutex保护下重新计算一次。
+func computeSlotMap(cluster *topo.Cluster) *[numSlots]*topo.Node {
+	var sm [numSlots]*topo.Node
+	for _, node := range cluster.LocalRegionNodes() {
+		for _, r := range node.Ranges() {
+			for slot := r.Left; slot <= r.Right; slot++ {
+				sm[slot] = node
+			}
+		}
+	}
+	return &sm
+}
+
+// SlotMap返回上一个tick计算出的slot -> node映射
+func (self *Spectator) SlotMap() [numSlots]*topo.Node {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if self.slotMap == nil {
+		return [numSlots]*topo.Node{}
+	}
+	return *self.slotMap
+}
+
+// NodeForKey返回key(支持{hashtag})哈希到的slot所属的节点,这样基于本模块
+// 搭建的proxy/工具就不用自己重新实现一遍Redis Cluster的哈希逻辑。
+func (self *Spectator) NodeForKey(key []byte) *topo.Node {
+	self.mutex.RLock()
+	defer self.mutex.RUnlock()
+
+	if self.slotMap == nil {
+		return nil
+	}
+	return self.slotMap[keySlot(key)]
+}
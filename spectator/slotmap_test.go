@@ -0,0 +1,62 @@
+package spectator
+
+import "testing"
+
+func TestCrc16(t *testing.T) {
+	cases := []struct {
+		in   string
+		want uint16
+	}{
+		{"", 0x0000},
+		{"123456789", 0x31C3},
+	}
+
+	for _, c := range cases {
+		if got := crc16([]byte(c.in)); got != c.want {
+			t.Errorf("crc16(%q) = %#04x, want %#04x", c.in, got, c.want)
+		}
+	}
+}
+
+func TestHashtagKey(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"foo", "foo"},
+		{"{user1000}.following", "user1000"},
+		{"foo{}bar", "foo{}bar"},
+		{"{user1000}.following{user1001}", "user1000"},
+	}
+
+	for _, c := range cases {
+		if got := string(hashtagKey([]byte(c.in))); got != c.want {
+			t.Errorf("hashtagKey(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestKeySlot(t *testing.T) {
+	cases := []struct {
+		in   string
+		want int
+	}{
+		{"foo", 12182},
+		{"bar", 5061},
+		{"hello", 866},
+	}
+
+	for _, c := range cases {
+		if got := keySlot([]byte(c.in)); got != c.want {
+			t.Errorf("keySlot(%q) = %d, want %d", c.in, got, c.want)
+		}
+	}
+}
+
+func TestKeySlotHashtag(t *testing.T) {
+	a := keySlot([]byte("{user1000}.following"))
+	b := keySlot([]byte("user1000"))
+	if a != b {
+		t.Errorf("keySlot with hashtag = %d, want %d (same slot as bare key)", a, b)
+	}
+}
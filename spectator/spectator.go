@@ -1,6 +1,7 @@
 package spectator
 
 import (
+	"context"
 	"errors"
 	"log"
 	"sort"
@@ -20,26 +21,94 @@ var (
 	ErrNodesInfoNotSame = errors.New("spectator: 'cluster nodes' info returned by seeds are different")
 )
 
+// defaultTickInterval在SpectatorOptions.TickInterval为零值时使用
+const defaultTickInterval = time.Second
+
+// SpectatorOptions控制Spectator的轮询和持久化行为。零值也是合法的:会回退
+// 到defaultTickInterval,且不使用TopoStore。
+type SpectatorOptions struct {
+	TickInterval time.Duration
+
+	// StoreURI指向用于持久化快照的TopoStore后端,例如
+	// "file:///var/lib/cc/topo"、"leveldb:///var/lib/cc/topo.db"或
+	// "redis://127.0.0.1:6379"。留空则不持久化快照。
+	StoreURI  string
+	Retention RetentionPolicy
+
+	// Quorum控制gossip quorum下PFAIL->FAIL状态转换和恢复的阈值。
+	// 零值会回退到defaultQuorum。
+	Quorum QuorumConfig
+}
+
 type Spectator struct {
 	mutex       *sync.RWMutex
 	Seeds       []*topo.Node
 	ClusterTopo *topo.Cluster
+
+	opts      SpectatorOptions
+	latencies *latencyStats
+	tickCount int64
+	events    *topoEventBus
+	store     TopoStore
+	slotMap   *[numSlots]*topo.Node
+
+	quorum *quorumTracker
+	// tickPFailObservers累积当前这次BuildClusterTopo调用中,每个节点id
+	// 被哪些seed上报了PFail。
+	tickPFailObservers map[string]map[string]bool
 }
 
-func NewSpectator(seeds []*topo.Node) *Spectator {
+func NewSpectator(seeds []*topo.Node, opts SpectatorOptions) *Spectator {
 	sp := &Spectator{
-		mutex: &sync.RWMutex{},
-		Seeds: seeds,
+		mutex:     &sync.RWMutex{},
+		Seeds:     seeds,
+		opts:      opts,
+		latencies: newLatencyStats(),
+		events:    newTopoEventBus(),
+		quorum:    newQuorumTracker(opts.Quorum),
 	}
+
+	if opts.StoreURI != "" {
+		store, err := NewTopoStore(opts.StoreURI, opts.Retention)
+		if err != nil {
+			log.Printf("spectator: failed to create topo store: %v", err)
+		} else {
+			sp.store = store
+			// 用最后一份快照做warm-start,这样第一次真正的BuildClusterTopo
+			// 完成之前,MaxReploffSlibing和Subscribe就已经可用了。
+			// ClosestReplicaInReplicaSet在第一次延迟探测之前没有RTT样本,
+			// 返回ErrNoReplicaAvailable。
+			if cluster, err := store.Load(context.Background()); err == nil {
+				sp.ClusterTopo = cluster
+			}
+		}
+	}
+
 	return sp
 }
 
-func (self *Spectator) Run() {
-	tickChan := time.NewTicker(time.Second * 1).C
+// Run每隔opts.TickInterval轮询一次集群拓扑,直到ctx被取消。当前正在进行的
+// tick(如果有)结束、且不再处理后续tick之后才返回。
+func (self *Spectator) Run(ctx context.Context) error {
+	interval := self.opts.TickInterval
+	if interval <= 0 {
+		interval = defaultTickInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
-		case <-tickChan:
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
 			self.BuildClusterTopo()
+			self.probeLatencies()
+
+			self.mutex.Lock()
+			self.tickCount++
+			self.mutex.Unlock()
 		}
 	}
 }
@@ -120,7 +189,19 @@ func (self *Spectator) FetchReplOffsetInReplicaSet(rs *topo.ReplicaSet) map[stri
 	return result
 }
 
-func (self *Spectator) buildNode(line string) (*topo.Node, error) {
+// recordPFailObserver记录seedAddr在当前正在构建的这个tick里把nodeId上报为
+// PFail。这个map挂在Spectator上(而不是随用随弃的*topo.Cluster),这样
+// quorumTracker才能看到跨tick的历史。
+func (self *Spectator) recordPFailObserver(nodeId, seedAddr string) {
+	observers, ok := self.tickPFailObservers[nodeId]
+	if !ok {
+		observers = map[string]bool{}
+		self.tickPFailObservers[nodeId] = observers
+	}
+	observers[seedAddr] = true
+}
+
+func (self *Spectator) buildNode(line, seedAddr string) (*topo.Node, error) {
 	xs := strings.Split(line, " ")
 	mod, tag, id, addr, flags, parent := xs[0], xs[1], xs[2], xs[3], xs[4], xs[5]
 	node := topo.NewNodeFromString(addr)
@@ -156,7 +237,7 @@ func (self *Spectator) buildNode(line string) (*topo.Node, error) {
 	}
 	if strings.Contains(flags, "fail?") {
 		node.SetPFail(true)
-		node.IncrPFailCount()
+		self.recordPFailObserver(id, seedAddr)
 	}
 	xs = strings.Split(tag, ":")
 	if len(xs) != 3 {
@@ -184,7 +265,7 @@ func (self *Spectator) initClusterTopo(seed *topo.Node) (*topo.Cluster, error) {
 			continue
 		}
 
-		node, err := self.buildNode(line)
+		node, err := self.buildNode(line, seed.Addr())
 		if err != nil {
 			return nil, err
 		}
@@ -207,7 +288,7 @@ func (self *Spectator) checkClusterTopo(seed *topo.Node, cluster *topo.Cluster)
 			continue
 		}
 
-		s, err := self.buildNode(line)
+		s, err := self.buildNode(line, seed.Addr())
 		if err != nil {
 			return err
 		}
@@ -220,10 +301,6 @@ func (self *Spectator) checkClusterTopo(seed *topo.Node, cluster *topo.Cluster)
 		if !node.Compare(s) {
 			return ErrNodesInfoNotSame
 		}
-
-		if s.PFail() {
-			node.IncrPFailCount()
-		}
 	}
 
 	return nil
@@ -248,6 +325,8 @@ func (self *Spectator) BuildClusterTopo() (*topo.Cluster, error) {
 		return nil, ErrNoSeed
 	}
 
+	self.tickPFailObservers = map[string]map[string]bool{}
+
 	seed := seeds[0]
 	cluster, err := self.initClusterTopo(seed)
 	if err != nil {
@@ -263,18 +342,49 @@ func (self *Spectator) BuildClusterTopo() (*topo.Cluster, error) {
 		}
 	}
 
+	if err := self.mergeClusterSlots(cluster, seed); err != nil {
+		log.Printf("spectator: failed to fetch CLUSTER SLOTS from %s: %v", seed.Addr(), err)
+	}
+
 	for _, s := range cluster.LocalRegionNodes() {
-		if s.PFailCount() > cluster.NumLocalRegionNode()/2 {
-			log.Printf("found %d/%d PFAIL state on %s, turning into FAIL state.",
-				s.PFailCount(), cluster.NumLocalRegionNode(), s.Addr())
+		evType, changed := self.quorum.observe(s.Id(), self.tickPFailObservers[s.Id()])
+		// cluster每个tick都从头重建,FAIL状态保存在quorumTracker里,所以每个
+		// tick都按它重新设置,而不只在跨越阈值的那个tick设置。
+		s.SetFail(self.quorum.windowFor(s.Id()).failing)
+		if !changed {
+			continue
+		}
+
+		switch evType {
+		case NodeSuspected:
+			log.Printf("node %s reached PFAIL quorum (seen by %d seeds, required %d) over %d ticks, turning into FAIL state.",
+				s.Addr(), len(self.tickPFailObservers[s.Id()]), self.quorum.cfg.RequiredSeeds, self.quorum.cfg.RequiredTicks)
 			s.SetFail(true)
+		case NodeRecovered:
+			log.Printf("node %s has been clean for %d ticks, clearing FAIL state.",
+				s.Addr(), self.quorum.cfg.RecoveryTicks)
+			s.SetFail(false)
 		}
+		self.events.publish(TopoEvent{Type: evType, NodeId: s.Id()})
 	}
 
 	cluster.BuildReplicaSets()
 
+	for _, ev := range diffClusterTopo(self.ClusterTopo, cluster) {
+		self.events.publish(ev)
+	}
+
 	self.Seeds = cluster.LocalRegionNodes()
 	self.ClusterTopo = cluster
+	self.slotMap = computeSlotMap(cluster)
+
+	if self.store != nil {
+		go func(snapshot *topo.Cluster) {
+			if err := self.store.Save(context.Background(), snapshot); err != nil {
+				log.Printf("spectator: failed to persist topo snapshot: %v", err)
+			}
+		}(cluster)
+	}
 
 	return cluster, nil
 }
\ No newline at end of file
@@ -0,0 +1,216 @@
+package spectator
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/jxwr/cc/topo"
+)
+
+var ErrNoSnapshot = errors.New("spectator: no topo snapshot found")
+
+// SnapshotMeta 描述一份已持久化的拓扑快照,不加载完整内容
+type SnapshotMeta struct {
+	Id        string
+	Timestamp time.Time
+}
+
+// NodeSnapshot 是*topo.Node的导出镜像,便于gob/JSON序列化。topo.Node的状态全部
+// 保存在只能通过Id()、Tag()、Role()、Ranges()等accessor访问的未导出字段里,
+// encoding/gob会静默跳过这些字段,所以TopoStore实际(反)序列化的是这个结构体。
+type NodeSnapshot struct {
+	Id        string
+	Addr      string
+	ParentId  string
+	Tag       string
+	Region    string
+	Zone      string
+	Room      string
+	Role      string
+	Readable  bool
+	Writable  bool
+	Migrating bool
+	PFail     bool
+	Fail      bool
+	Ranges    []topo.Range
+}
+
+// ClusterSnapshot 是TopoStore实现实际序列化的*topo.Cluster导出镜像。分片
+// (replica set)归属不直接存储,而是在加载快照时通过每个节点的ParentId经
+// BuildReplicaSets重建,和BuildClusterTopo的做法一致。
+type ClusterSnapshot struct {
+	Nodes []NodeSnapshot
+}
+
+// snapshotCluster用本包其余部分依赖的那套公开accessor,把cluster转成ClusterSnapshot
+func snapshotCluster(cluster *topo.Cluster) *ClusterSnapshot {
+	snap := &ClusterSnapshot{}
+	for _, n := range cluster.LocalRegionNodes() {
+		snap.Nodes = append(snap.Nodes, NodeSnapshot{
+			Id:        n.Id(),
+			Addr:      n.Addr(),
+			ParentId:  n.ParentId(),
+			Tag:       n.Tag(),
+			Region:    n.Region(),
+			Zone:      n.Zone(),
+			Room:      n.Room(),
+			Role:      n.Role(),
+			Readable:  n.Readable(),
+			Writable:  n.Writable(),
+			Migrating: n.Migrating(),
+			PFail:     n.PFail(),
+			Fail:      n.Fail(),
+			Ranges:    n.Ranges(),
+		})
+	}
+	return snap
+}
+
+// toCluster从snap重建*topo.Cluster,走的是buildNode解析实时CLUSTER NODES
+// 响应时用的那套setter。
+func (snap *ClusterSnapshot) toCluster() *topo.Cluster {
+	cluster := topo.NewCluster("bj")
+
+	for _, ns := range snap.Nodes {
+		node := topo.NewNodeFromString(ns.Addr)
+		node.SetId(ns.Id)
+		node.SetParentId(ns.ParentId)
+		node.SetTag(ns.Tag)
+		node.SetRegion(ns.Region)
+		node.SetZone(ns.Zone)
+		node.SetRoom(ns.Room)
+		node.SetRole(ns.Role)
+		node.SetReadable(ns.Readable)
+		node.SetWritable(ns.Writable)
+		node.SetMigrating(ns.Migrating)
+		node.SetPFail(ns.PFail)
+		node.SetFail(ns.Fail)
+		for _, r := range ns.Ranges {
+			node.AddRange(r)
+		}
+		cluster.AddNode(node)
+	}
+
+	cluster.BuildReplicaSets()
+	return cluster
+}
+
+// encodeSnapshot通过导出的ClusterSnapshot镜像对cluster做gob编码,
+// 被每个TopoStore后端的Save共用。
+func encodeSnapshot(cluster *topo.Cluster) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(snapshotCluster(cluster)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// decodeSnapshot是encodeSnapshot的逆操作,被每个TopoStore后端的Load/Get共用。
+func decodeSnapshot(data []byte) (*topo.Cluster, error) {
+	var snap ClusterSnapshot
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&snap); err != nil {
+		return nil, err
+	}
+	return snap.toCluster(), nil
+}
+
+// TopoStore持久化ClusterTopo快照,让controller重启后能warm-start,也为
+// failover/迁移决策发生时的拓扑状态留一份可追溯的记录。
+type TopoStore interface {
+	Save(ctx context.Context, snapshot *topo.Cluster) error
+	Load(ctx context.Context) (*topo.Cluster, error)
+	List(ctx context.Context, since time.Time) ([]SnapshotMeta, error)
+	Get(ctx context.Context, id string) (*topo.Cluster, error)
+}
+
+// RetentionPolicy限制TopoStore保留多少份快照、或保留多长时间。字段为零值
+// 表示该维度不做限制。
+type RetentionPolicy struct {
+	KeepLast int
+	KeepFor  time.Duration
+}
+
+// filterAndSortMetas丢弃早于since的条目,并按时间顺序返回剩下的——这是每个
+// TopoStore后端List()共用的后处理步骤,与各自如何枚举原始条目无关。
+func filterAndSortMetas(metas []SnapshotMeta, since time.Time) []SnapshotMeta {
+	filtered := make([]SnapshotMeta, 0, len(metas))
+	for _, m := range metas {
+		if m.Timestamp.Before(since) {
+			continue
+		}
+		filtered = append(filtered, m)
+	}
+
+	sort.Slice(filtered, func(i, j int) bool {
+		return filtered[i].Timestamp.Before(filtered[j].Timestamp)
+	})
+
+	return filtered
+}
+
+// metasToDelete从按时间排好序的metas中,按retention的规则算出该删除哪些:
+// 早于KeepFor的,加上排在最后KeepLast条之前的那些。这是每个TopoStore后端
+// enforceRetention共用的计算逻辑,各后端只是删除的具体操作不同。
+func metasToDelete(metas []SnapshotMeta, retention RetentionPolicy) []SnapshotMeta {
+	if retention.KeepLast <= 0 && retention.KeepFor <= 0 {
+		return nil
+	}
+
+	cutoff := time.Time{}
+	if retention.KeepFor > 0 {
+		cutoff = time.Now().Add(-retention.KeepFor)
+	}
+
+	keepFrom := 0
+	if retention.KeepLast > 0 && len(metas) > retention.KeepLast {
+		keepFrom = len(metas) - retention.KeepLast
+	}
+
+	stale := []SnapshotMeta{}
+	for i, m := range metas {
+		if i < keepFrom || m.Timestamp.Before(cutoff) {
+			stale = append(stale, m)
+		}
+	}
+
+	return stale
+}
+
+// loadLatest实现了公共的Load():列出从最早时间开始的全部快照,取最新的一份。
+func loadLatest(ctx context.Context, store TopoStore) (*topo.Cluster, error) {
+	metas, err := store.List(ctx, time.Time{})
+	if err != nil {
+		return nil, err
+	}
+	if len(metas) == 0 {
+		return nil, ErrNoSnapshot
+	}
+
+	return store.Get(ctx, metas[len(metas)-1].Id)
+}
+
+// NewTopoStore根据URI构造TopoStore,复用了本项目其它地方指向存储后端时
+// 用的redis://host:port、leveldb://path这套约定。
+func NewTopoStore(uri string, retention RetentionPolicy) (TopoStore, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, fmt.Errorf("spectator: invalid store uri %q: %v", uri, err)
+	}
+
+	switch u.Scheme {
+	case "file":
+		return newFileTopoStore(u.Path, retention), nil
+	case "leveldb":
+		return newLevelDBTopoStore(u.Path, retention)
+	case "redis":
+		return newRedisTopoStore(u.Host, retention)
+	default:
+		return nil, fmt.Errorf("spectator: unknown store scheme %q", u.Scheme)
+	}
+}
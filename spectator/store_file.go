@@ -0,0 +1,100 @@
+package spectator
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jxwr/cc/topo"
+)
+
+// fileTopoStore把快照以gob编码的形式存成目录下的文件,一份快照一个文件,
+// 文件名是保存时的unix纳秒时间戳。
+type fileTopoStore struct {
+	dir       string
+	retention RetentionPolicy
+}
+
+func newFileTopoStore(dir string, retention RetentionPolicy) *fileTopoStore {
+	return &fileTopoStore{dir: dir, retention: retention}
+}
+
+func (s *fileTopoStore) Save(ctx context.Context, snapshot *topo.Cluster) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	id := strconv.FormatInt(time.Now().UnixNano(), 10)
+	path := filepath.Join(s.dir, id+".gob")
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+
+	return s.enforceRetention()
+}
+
+func (s *fileTopoStore) Load(ctx context.Context) (*topo.Cluster, error) {
+	return loadLatest(ctx, s)
+}
+
+func (s *fileTopoStore) List(ctx context.Context, since time.Time) ([]SnapshotMeta, error) {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	metas := []SnapshotMeta{}
+	for _, e := range entries {
+		id := strings.TrimSuffix(e.Name(), ".gob")
+		nanos, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			continue
+		}
+		metas = append(metas, SnapshotMeta{Id: id, Timestamp: time.Unix(0, nanos)})
+	}
+
+	return filterAndSortMetas(metas, since), nil
+}
+
+func (s *fileTopoStore) Get(ctx context.Context, id string) (*topo.Cluster, error) {
+	// id is surfaced through the public TopoStore interface, so it may come
+	// from an untrusted caller (e.g. the HTTP/API layer). Reject anything
+	// that isn't the unix-nano timestamp Save() generates before joining it
+	// into a filesystem path, or a "../" id could escape s.dir.
+	if _, err := strconv.ParseInt(id, 10, 64); err != nil {
+		return nil, fmt.Errorf("spectator: invalid snapshot id %q", id)
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, id+".gob"))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot(data)
+}
+
+func (s *fileTopoStore) enforceRetention() error {
+	metas, err := s.List(context.Background(), time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metasToDelete(metas, s.retention) {
+		os.Remove(filepath.Join(s.dir, m.Id+".gob"))
+	}
+
+	return nil
+}
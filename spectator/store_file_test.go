@@ -0,0 +1,17 @@
+package spectator
+
+import (
+	"context"
+	"testing"
+)
+
+func TestFileTopoStoreGetRejectsNonNumericId(t *testing.T) {
+	s := newFileTopoStore(t.TempDir(), RetentionPolicy{})
+
+	cases := []string{"../../etc/passwd", "../secret", "not-a-timestamp", ""}
+	for _, id := range cases {
+		if _, err := s.Get(context.Background(), id); err == nil {
+			t.Errorf("Get(%q) = nil error, want it rejected before being joined into a filesystem path", id)
+		}
+	}
+}
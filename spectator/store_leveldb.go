@@ -0,0 +1,92 @@
+package spectator
+
+import (
+	"context"
+	"encoding/binary"
+	"strconv"
+	"time"
+
+	"github.com/jxwr/cc/topo"
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+// leveldbTopoStore用big-endian编码的unix纳秒时间戳作为快照的key,这样
+// LevelDB自带的key顺序就能直接当按时间遍历用,不用额外排序。
+type leveldbTopoStore struct {
+	db        *leveldb.DB
+	retention RetentionPolicy
+}
+
+func newLevelDBTopoStore(path string, retention RetentionPolicy) (*leveldbTopoStore, error) {
+	db, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &leveldbTopoStore{db: db, retention: retention}, nil
+}
+
+func snapshotKey(nanos int64) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(nanos))
+	return key
+}
+
+func (s *leveldbTopoStore) Save(ctx context.Context, snapshot *topo.Cluster) error {
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	if err := s.db.Put(snapshotKey(time.Now().UnixNano()), data, nil); err != nil {
+		return err
+	}
+
+	return s.enforceRetention()
+}
+
+func (s *leveldbTopoStore) Load(ctx context.Context) (*topo.Cluster, error) {
+	return loadLatest(ctx, s)
+}
+
+func (s *leveldbTopoStore) List(ctx context.Context, since time.Time) ([]SnapshotMeta, error) {
+	iter := s.db.NewIterator(nil, nil)
+	defer iter.Release()
+
+	metas := []SnapshotMeta{}
+	for iter.Next() {
+		nanos := int64(binary.BigEndian.Uint64(iter.Key()))
+		metas = append(metas, SnapshotMeta{Id: strconv.FormatInt(nanos, 10), Timestamp: time.Unix(0, nanos)})
+	}
+	if err := iter.Error(); err != nil {
+		return nil, err
+	}
+
+	return filterAndSortMetas(metas, since), nil
+}
+
+func (s *leveldbTopoStore) Get(ctx context.Context, id string) (*topo.Cluster, error) {
+	nanos, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.db.Get(snapshotKey(nanos), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot(data)
+}
+
+func (s *leveldbTopoStore) enforceRetention() error {
+	metas, err := s.List(context.Background(), time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metasToDelete(metas, s.retention) {
+		s.db.Delete(snapshotKey(m.Timestamp.UnixNano()), nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,99 @@
+package spectator
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	redigo "github.com/garyburd/redigo/redis"
+
+	"github.com/jxwr/cc/topo"
+)
+
+// redisSnapshotHashKey是存放所有快照的唯一一个hash,每份快照一个field,
+// field名是其unix纳秒时间戳。
+const redisSnapshotHashKey = "cc:spectator:topo-snapshots"
+
+// redisTopoStore沿用了本项目里其它时间序列历史数据已经在用的那套
+// "单个hash,按时间戳做field"的布局。
+type redisTopoStore struct {
+	pool      *redigo.Pool
+	retention RetentionPolicy
+}
+
+func newRedisTopoStore(addr string, retention RetentionPolicy) (*redisTopoStore, error) {
+	pool := &redigo.Pool{
+		MaxIdle: 3,
+		Dial: func() (redigo.Conn, error) {
+			return redigo.Dial("tcp", addr)
+		},
+	}
+	return &redisTopoStore{pool: pool, retention: retention}, nil
+}
+
+func (s *redisTopoStore) Save(ctx context.Context, snapshot *topo.Cluster) error {
+	data, err := encodeSnapshot(snapshot)
+	if err != nil {
+		return err
+	}
+
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	field := strconv.FormatInt(time.Now().UnixNano(), 10)
+	if _, err := conn.Do("HSET", redisSnapshotHashKey, field, data); err != nil {
+		return err
+	}
+
+	return s.enforceRetention(conn)
+}
+
+func (s *redisTopoStore) Load(ctx context.Context) (*topo.Cluster, error) {
+	return loadLatest(ctx, s)
+}
+
+func (s *redisTopoStore) List(ctx context.Context, since time.Time) ([]SnapshotMeta, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	fields, err := redigo.Strings(conn.Do("HKEYS", redisSnapshotHashKey))
+	if err != nil {
+		return nil, err
+	}
+
+	metas := []SnapshotMeta{}
+	for _, field := range fields {
+		nanos, err := strconv.ParseInt(field, 10, 64)
+		if err != nil {
+			continue
+		}
+		metas = append(metas, SnapshotMeta{Id: field, Timestamp: time.Unix(0, nanos)})
+	}
+
+	return filterAndSortMetas(metas, since), nil
+}
+
+func (s *redisTopoStore) Get(ctx context.Context, id string) (*topo.Cluster, error) {
+	conn := s.pool.Get()
+	defer conn.Close()
+
+	data, err := redigo.Bytes(conn.Do("HGET", redisSnapshotHashKey, id))
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeSnapshot(data)
+}
+
+func (s *redisTopoStore) enforceRetention(conn redigo.Conn) error {
+	metas, err := s.List(context.Background(), time.Time{})
+	if err != nil {
+		return err
+	}
+
+	for _, m := range metasToDelete(metas, s.retention) {
+		conn.Do("HDEL", redisSnapshotHashKey, m.Id)
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package spectator
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jxwr/cc/topo"
+)
+
+func TestFilterAndSortMetas(t *testing.T) {
+	now := time.Unix(1000, 0)
+	metas := []SnapshotMeta{
+		{Id: "c", Timestamp: now},
+		{Id: "a", Timestamp: now.Add(-2 * time.Hour)},
+		{Id: "b", Timestamp: now.Add(-1 * time.Hour)},
+	}
+
+	got := filterAndSortMetas(metas, now.Add(-90*time.Minute))
+	if len(got) != 2 || got[0].Id != "b" || got[1].Id != "c" {
+		t.Fatalf("filterAndSortMetas() = %+v, want [b, c] in chronological order", got)
+	}
+}
+
+func TestMetasToDeleteKeepLast(t *testing.T) {
+	now := time.Unix(1000, 0)
+	metas := []SnapshotMeta{
+		{Id: "a", Timestamp: now.Add(-3 * time.Hour)},
+		{Id: "b", Timestamp: now.Add(-2 * time.Hour)},
+		{Id: "c", Timestamp: now.Add(-1 * time.Hour)},
+	}
+
+	stale := metasToDelete(metas, RetentionPolicy{KeepLast: 2})
+	if len(stale) != 1 || stale[0].Id != "a" {
+		t.Fatalf("metasToDelete() with KeepLast=2 = %+v, want [a]", stale)
+	}
+}
+
+func TestMetasToDeleteKeepFor(t *testing.T) {
+	// metasToDelete measures KeepFor against the wall clock, so the
+	// timestamps here have to be relative to time.Now().
+	now := time.Now()
+	metas := []SnapshotMeta{
+		{Id: "a", Timestamp: now.Add(-3 * time.Hour)},
+		{Id: "b", Timestamp: now.Add(-1 * time.Hour)},
+	}
+
+	stale := metasToDelete(metas, RetentionPolicy{KeepFor: 2 * time.Hour})
+	if len(stale) != 1 || stale[0].Id != "a" {
+		t.Fatalf("metasToDelete() with KeepFor=2h = %+v, want [a]", stale)
+	}
+}
+
+func TestMetasToDeleteZeroPolicy(t *testing.T) {
+	metas := []SnapshotMeta{{Id: "a"}, {Id: "b"}}
+	if stale := metasToDelete(metas, RetentionPolicy{}); stale != nil {
+		t.Fatalf("metasToDelete() with the zero RetentionPolicy = %+v, want nil (unbounded)", stale)
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	cluster := topo.NewCluster("bj")
+
+	node := topo.NewNodeFromString("127.0.0.1:7000")
+	node.SetId("node1")
+	node.SetParentId("")
+	node.SetTag("bj:a:r1")
+	node.SetRegion("bj")
+	node.SetZone("a")
+	node.SetRoom("r1")
+	node.SetRole("master")
+	node.SetReadable(true)
+	node.SetWritable(true)
+	node.SetMigrating(false)
+	node.SetPFail(false)
+	node.SetFail(false)
+	node.AddRange(topo.Range{0, 100})
+	cluster.AddNode(node)
+
+	snap := snapshotCluster(cluster)
+	if len(snap.Nodes) != 1 {
+		t.Fatalf("snapshotCluster() produced %d nodes, want 1", len(snap.Nodes))
+	}
+
+	got := snap.toCluster().LocalRegionNodes()
+	if len(got) != 1 {
+		t.Fatalf("toCluster() produced %d nodes, want 1", len(got))
+	}
+
+	rt := got[0]
+	if rt.Id() != node.Id() || rt.Addr() != node.Addr() || rt.Tag() != node.Tag() ||
+		rt.Role() != node.Role() || rt.Readable() != node.Readable() || rt.Writable() != node.Writable() {
+		t.Fatalf("round-tripped node = %+v, want it to match the original node's basic fields", rt)
+	}
+	if !sameRanges(rt.Ranges(), node.Ranges()) {
+		t.Fatalf("round-tripped node ranges = %v, want %v", rt.Ranges(), node.Ranges())
+	}
+}